@@ -65,8 +65,15 @@ func main() {
 		log.Fatal().Err(err).Msg("Cannot initialize swarm-cronjob")
 	}
 
+	// Leader election for HA deployments
+	if cli.LeaderElection {
+		if err := sc.EnableLeaderElection(&cli); err != nil {
+			log.Fatal().Err(err).Msg("Cannot enable leader election")
+		}
+	}
+
 	// configure and run EventService
-	es = eventservice.NewEventService(sc, cli.EventPort, cli.EventTimeout)
+	es = eventservice.NewEventService(sc, &cli)
 	es.Run()
 
 	// Run
@@ -3,10 +3,17 @@ package app
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/crazy-max/swarm-cronjob/internal/docker"
+	"github.com/crazy-max/swarm-cronjob/internal/election"
+	"github.com/crazy-max/swarm-cronjob/internal/metrics"
 	"github.com/crazy-max/swarm-cronjob/internal/model"
 	"github.com/crazy-max/swarm-cronjob/internal/worker"
 	"github.com/docker/docker/api/types"
@@ -17,11 +24,20 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// execLabelPrefix is the prefix of per-exec-job labels, e.g.
+// swarm.cronjob.exec.<name>.schedule and swarm.cronjob.exec.<name>.command
+const execLabelPrefix = "swarm.cronjob.exec."
+
 // SwarmCronjob represents an active swarm-cronjob object
 type SwarmCronjob struct {
-	docker docker.Client
-	cron   *cron.Cron
-	jobs   map[string]cron.EntryID
+	docker    docker.Client
+	cron      *cron.Cron
+	jobs      map[string][]cron.EntryID
+	metrics   *metrics.Collector
+	connected int32
+
+	elector election.Elector
+	leading int32
 }
 
 // New creates new swarm-cronjob instance
@@ -34,10 +50,99 @@ func New() (*SwarmCronjob, error) {
 		cron: cron.New(cron.WithParser(cron.NewParser(
 			cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor),
 		)),
-		jobs: make(map[string]cron.EntryID),
+		jobs:    make(map[string][]cron.EntryID),
+		metrics: metrics.New(),
 	}, err
 }
 
+// Metrics returns the Prometheus collector backing this instance
+func (sc *SwarmCronjob) Metrics() *metrics.Collector {
+	return sc.metrics
+}
+
+// Ready reports whether the Docker events loop is currently connected,
+// used as the readiness signal for the /readyz endpoint
+func (sc *SwarmCronjob) Ready() bool {
+	return atomic.LoadInt32(&sc.connected) == 1
+}
+
+// SetElector enables leader election: only the elected leader starts the
+// cron scheduler and processes event-driven runs. Must be called before Run.
+func (sc *SwarmCronjob) SetElector(e election.Elector) {
+	sc.elector = e
+}
+
+// EnableLeaderElection builds and installs an Elector for the given backend
+// from the CLI flags. Must be called before Run.
+func (sc *SwarmCronjob) EnableLeaderElection(cli *model.Cli) error {
+	leaseDuration, err := time.ParseDuration(cli.LeaderElectionLeaseDuration)
+	if err != nil {
+		return err
+	}
+
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		return errors.New("cannot determine leader election identity from hostname")
+	}
+
+	e, err := election.New(cli.LeaderElectionBackend, sc.docker, cli.LeaderElectionRedisAddr, election.Config{
+		Namespace:     cli.LeaderElectionNamespace,
+		Identity:      identity,
+		LeaseDuration: leaseDuration,
+	})
+	if err != nil {
+		return err
+	}
+
+	sc.SetElector(e)
+	return nil
+}
+
+// IsLeader reports whether this replica is allowed to fire runs. With no
+// elector configured, every replica is its own leader (today's behavior).
+func (sc *SwarmCronjob) IsLeader() bool {
+	if sc.elector == nil {
+		return true
+	}
+	return atomic.LoadInt32(&sc.leading) == 1
+}
+
+// watchLeadership starts/stops the cron scheduler as leadership is gained
+// or lost, and keeps the leader gauge and /healthz state up to date. Docker
+// event handling in Run keeps sc.jobs current regardless of leadership so
+// failover is instant once leadership changes.
+func (sc *SwarmCronjob) watchLeadership(ctx context.Context) {
+	go sc.elector.Run(ctx)
+
+	wasLeader := false
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			leading := sc.elector.IsLeader()
+			if leading {
+				atomic.StoreInt32(&sc.leading, 1)
+			} else {
+				atomic.StoreInt32(&sc.leading, 0)
+			}
+			sc.metrics.SetLeader(leading)
+
+			if leading && !wasLeader {
+				log.Info().Msg("Acquired leadership, starting cron scheduler")
+				sc.cron.Start()
+			} else if !leading && wasLeader {
+				log.Info().Msg("Lost leadership, stopping cron scheduler")
+				sc.cron.Stop()
+			}
+			wasLeader = leading
+		}
+	}
+}
+
 // Run starts swarm-cronjob process
 func (sc *SwarmCronjob) Run() error {
 	// Find scheduled services
@@ -59,9 +164,14 @@ func (sc *SwarmCronjob) Run() error {
 		}
 	}
 
-	// Start cron routine
-	log.Debug().Msg("Starting the cron scheduler")
-	sc.cron.Start()
+	// Start cron routine, gated on leadership when election is enabled
+	if sc.elector != nil {
+		log.Debug().Msg("Leader election enabled, deferring cron scheduler to leadership")
+		go sc.watchLeadership(context.Background())
+	} else {
+		log.Debug().Msg("Starting the cron scheduler")
+		sc.cron.Start()
+	}
 
 	// Listen Docker events
 	log.Debug().Msg("Listening docker events...")
@@ -71,11 +181,13 @@ func (sc *SwarmCronjob) Run() error {
 	msgs, errs := sc.docker.Events(context.Background(), types.EventsOptions{
 		Filters: filter,
 	})
+	atomic.StoreInt32(&sc.connected, 1)
 
 	var event model.ServiceEvent
 	for {
 		select {
 		case err := <-errs:
+			atomic.StoreInt32(&sc.connected, 0)
 			log.Fatal().Err(err).Msg("Event channel failed")
 		case msg := <-msgs:
 			err := mapstructure.Decode(msg.Actor.Attributes, &event)
@@ -101,15 +213,15 @@ func (sc *SwarmCronjob) Run() error {
 
 // crudJob adds, updates or removes cron job service
 func (sc *SwarmCronjob) crudJob(serviceName string) (bool, error) {
-	// Find existing job
-	jobID, jobFound := sc.jobs[serviceName]
+	// Find existing jobs
+	jobIDs, jobFound := sc.jobs[serviceName]
 
 	// Check service exists
 	service, err := sc.docker.Service(serviceName)
 	if err != nil {
 		if jobFound {
 			log.Info().Str("service", serviceName).Msg("Remove cronjob")
-			sc.removeJob(serviceName, jobID)
+			sc.removeJobs(serviceName, jobIDs)
 			return true, nil
 		}
 		log.Debug().Str("service", serviceName).Msg("Service does not exist (removed)")
@@ -118,17 +230,37 @@ func (sc *SwarmCronjob) crudJob(serviceName string) (bool, error) {
 
 	// Cronjob worker
 	wc := &worker.Client{
-		Docker: sc.docker,
+		Docker:  sc.docker,
+		Metrics: sc.metrics,
 		Job: model.Job{
-			Name:        service.Name,
-			Enable:      false,
-			SkipRunning: false,
-			Replicas:    1,
+			Name:              service.Name,
+			Enable:            false,
+			SkipRunning:       false,
+			Replicas:          1,
+			ConcurrencyPolicy: model.ConcurrencyAllow,
 		},
 	}
 
+	// exec jobs keyed by name, collected from swarm.cronjob.exec.<name>.* labels
+	execSchedules := make(map[string]string)
+	execCommands := make(map[string]string)
+
 	// Seek swarm.cronjob labels
 	for labelKey, labelValue := range service.Labels {
+		if strings.HasPrefix(labelKey, execLabelPrefix) {
+			name, field, ok := parseExecLabel(labelKey)
+			if !ok {
+				continue
+			}
+			switch field {
+			case "schedule":
+				execSchedules[name] = labelValue
+			case "command":
+				execCommands[name] = labelValue
+			}
+			continue
+		}
+
 		switch labelKey {
 		case "swarm.cronjob.enable":
 			wc.Job.Enable, err = strconv.ParseBool(labelValue)
@@ -150,6 +282,8 @@ func (sc *SwarmCronjob) crudJob(serviceName string) (bool, error) {
 			if err != nil {
 				log.Error().Str("service", service.Name).Err(err).Msgf("Cannot parse %s value of label %s", labelValue, labelKey)
 			}
+		case "swarm.cronjob.event.secret":
+			wc.Job.EventSecretName = labelValue
 		case "swarm.cronjob.skip-running":
 			wc.Job.SkipRunning, err = strconv.ParseBool(labelValue)
 			if err != nil {
@@ -172,35 +306,97 @@ func (sc *SwarmCronjob) crudJob(serviceName string) (bool, error) {
 				log.Debug().Str("service", service.Name).Msg("Scale down detected. Skipping cronjob")
 				return false, nil
 			}
+		case "swarm.cronjob.concurrency-policy":
+			switch labelValue {
+			case model.ConcurrencyAllow, model.ConcurrencyForbid, model.ConcurrencyReplace:
+				wc.Job.ConcurrencyPolicy = labelValue
+			default:
+				log.Error().Str("service", service.Name).Msgf("Unknown %s value %s", labelKey, labelValue)
+			}
+		case "swarm.cronjob.starting-deadline-seconds":
+			wc.Job.StartingDeadlineSeconds, err = strconv.ParseInt(labelValue, 10, 64)
+			if err != nil {
+				log.Error().Str("service", service.Name).Err(err).Msgf("Cannot parse %s value of label %s", labelValue, labelKey)
+			}
+		}
+	}
+
+	// Build one worker per exec job found
+	execWorkers := make(map[string]*worker.Client)
+	for name, schedule := range execSchedules {
+		command, ok := execCommands[name]
+		if !ok || schedule == "" || command == "" {
+			log.Error().Str("service", service.Name).Msgf("Exec job %q is missing a schedule or command", name)
+			continue
+		}
+		execWorkers[name] = &worker.Client{
+			Docker:  sc.docker,
+			Metrics: sc.metrics,
+			Job: model.Job{
+				Name:        service.Name,
+				Enable:      true,
+				Mode:        model.JobModeExec,
+				Schedule:    schedule,
+				ExecName:    name,
+				ExecCommand: splitCommand(command),
+			},
 		}
 	}
 
 	// Disabled or non-cron service
-	if !wc.Job.Enable {
+	if !wc.Job.Enable && len(execWorkers) == 0 {
 		if jobFound {
 			log.Info().Str("service", service.Name).Msg("Disable cronjob")
-			sc.removeJob(serviceName, jobID)
+			sc.removeJobs(serviceName, jobIDs)
 			return true, nil
 		}
 		log.Debug().Str("service", service.Name).Msg("Cronjob disabled")
 		return false, nil
 	}
 
-	// Add/Update job
+	// Add/Update jobs
 	if jobFound {
-		sc.removeJob(serviceName, jobID)
-		log.Debug().Str("service", service.Name).Msgf("Update cronjob with schedule %s", wc.Job.Schedule)
+		sc.removeJobs(serviceName, jobIDs)
+		log.Debug().Str("service", service.Name).Msg("Update cronjob")
 	} else {
-		log.Info().Str("service", service.Name).Msgf("Add cronjob with schedule %s", wc.Job.Schedule)
+		log.Info().Str("service", service.Name).Msg("Add cronjob")
 	}
 
-	jobID, err = sc.cron.AddJob(wc.Job.Schedule, wc)
-	if err != nil {
-		return false, err
+	var newIDs []cron.EntryID
+	if wc.Job.Enable {
+		jobID, err := sc.cron.AddJob(wc.Job.Schedule, wc)
+		if err != nil {
+			return false, err
+		}
+		wc.Cron = sc.cron
+		wc.EntryID = jobID
+		newIDs = append(newIDs, jobID)
+		sc.metrics.JobRegistered()
+		sc.metrics.SetNextScheduled(serviceName, sc.cron.Entry(jobID).Next)
 	}
 
-	sc.jobs[serviceName] = jobID
-	return true, err
+	// Register exec jobs in a stable order so behavior doesn't depend on map iteration
+	names := make([]string, 0, len(execWorkers))
+	for name := range execWorkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ec := execWorkers[name]
+		jobID, err := sc.cron.AddJob(ec.Job.Schedule, ec)
+		if err != nil {
+			log.Error().Str("service", service.Name).Err(err).Msgf("Cannot register exec job %q", name)
+			continue
+		}
+		ec.Cron = sc.cron
+		ec.EntryID = jobID
+		newIDs = append(newIDs, jobID)
+		sc.metrics.JobRegistered()
+		sc.metrics.SetNextScheduled(serviceName+"/"+name, sc.cron.Entry(jobID).Next)
+	}
+
+	sc.jobs[serviceName] = newIDs
+	return true, nil
 }
 
 // Close closes swarm-cronjob
@@ -210,19 +406,112 @@ func (sc *SwarmCronjob) Close() {
 	}
 }
 
-func (sc *SwarmCronjob) removeJob(serviceName string, id cron.EntryID) {
+func (sc *SwarmCronjob) removeJobs(serviceName string, ids []cron.EntryID) {
 	delete(sc.jobs, serviceName)
-	sc.cron.Remove(id)
+	for _, id := range ids {
+		metricsKey := serviceName
+		if wc, ok := sc.cron.Entry(id).Job.(*worker.Client); ok && wc.Job.Mode == model.JobModeExec {
+			metricsKey = serviceName + "/" + wc.Job.ExecName
+		}
+		sc.cron.Remove(id)
+		sc.metrics.JobRemoved(metricsKey)
+	}
+}
+
+// splitCommand tokenizes a swarm.cronjob.exec.<name>.command label with
+// shell-word semantics, so arguments containing spaces can be grouped with
+// single or double quotes (e.g. sh -c "echo a b"). Backslash escapes the
+// next character outside of single quotes. It does not perform variable
+// expansion or any other shell processing.
+func splitCommand(command string) []string {
+	var fields []string
+	var current strings.Builder
+	var quote rune
+	inField := false
+
+	flush := func() {
+		if inField {
+			fields = append(fields, current.String())
+			current.Reset()
+			inField = false
+		}
+	}
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+				continue
+			}
+			if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+				continue
+			}
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inField = true
+		case r == ' ' || r == '\t':
+			flush()
+		default:
+			current.WriteRune(r)
+			inField = true
+		}
+	}
+	flush()
+
+	return fields
+}
+
+// parseExecLabel splits a swarm.cronjob.exec.<name>.<field> label key into
+// its job name and field (schedule or command)
+func parseExecLabel(labelKey string) (name string, field string, ok bool) {
+	rest := strings.TrimPrefix(labelKey, execLabelPrefix)
+	parts := strings.SplitN(rest, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// mainJobEntry returns the replica-mode entry for a service, ignoring any
+// exec jobs registered alongside it, since event-driven runs only apply to
+// the primary scaling job
+func (sc *SwarmCronjob) mainJobEntry(serviceName string) (*worker.Client, bool) {
+	for _, id := range sc.jobs[serviceName] {
+		wc := sc.cron.Entry(id).Job.(*worker.Client)
+		if wc.Job.Mode != model.JobModeExec {
+			return wc, true
+		}
+	}
+	return nil, false
 }
 
 func (sc *SwarmCronjob) RunJobByEvent(serviceName string, key string) {
-	jobID, jobFound := sc.jobs[serviceName]
+	if !sc.IsLeader() {
+		log.Info().Str("service", serviceName).Msg("Not the leader, ignoring event-driven run")
+		return
+	}
+
+	wc, jobFound := sc.mainJobEntry(serviceName)
 
 	if jobFound {
-		wc := sc.cron.Entry(jobID).Job.(*worker.Client)
 		if wc.Job.EventRun {
 			if wc.Job.EventRunKey == key {
-				sc.cron.Entry(jobID).Job.Run()
+				// An event-driven run has no scheduled fire time of its own,
+				// so it is run without the cron entry and is not subject to
+				// the starting deadline
+				ev := *wc
+				ev.Cron = nil
+				ev.Run()
 			} else {
 				log.Info().Msgf("Wrong key for run job for service '%s'", serviceName)
 			}
@@ -239,61 +528,147 @@ func (sc *SwarmCronjob) Tasks(serviceName string) ([]*model.TaskInfo, error) {
 	return sc.docker.TaskList(serviceName)
 }
 
-func (sc *SwarmCronjob) WaitForEnd(serviceName string, tasks []*model.TaskInfo) (string, error) {
-	jobID, jobFound := sc.jobs[serviceName]
+// EventTimeout returns the configured event timeout for a service's job
+func (sc *SwarmCronjob) EventTimeout(serviceName string) (time.Duration, error) {
+	wc, found := sc.mainJobEntry(serviceName)
+	if !found {
+		return 0, errors.New("job not found")
+	}
+	return time.ParseDuration(wc.Job.EventTimeout)
+}
 
-	var wc *worker.Client
+// secretsMountDir is the path at which Docker mounts secrets inside a
+// container, used as a fallback when the engine doesn't hand back secret
+// data directly
+const secretsMountDir = "/run/secrets"
+
+// EventSecret returns the HMAC secret configured for a service's
+// swarm.cronjob.event.secret label. configured reports whether the label
+// is set at all, letting callers tell "no secret required" apart from
+// "secret required but couldn't be read" (err). The Swarm API only
+// returns a secret's payload to containers it's actually mounted into, so
+// this first asks the engine and falls back to reading the mounted file
+// under secretsMountDir.
+func (sc *SwarmCronjob) EventSecret(ctx context.Context, serviceName string) (secret []byte, configured bool, err error) {
+	wc, found := sc.mainJobEntry(serviceName)
+	if !found {
+		return nil, false, errors.New("job not found")
+	}
+	if wc.Job.EventSecretName == "" {
+		return nil, false, nil
+	}
 
-	if jobFound {
-		wc = sc.cron.Entry(jobID).Job.(*worker.Client)
+	sec, _, err := sc.docker.SecretInspectWithRaw(ctx, wc.Job.EventSecretName)
+	if err != nil {
+		return nil, true, err
 	}
+	if len(sec.Spec.Data) > 0 {
+		return sec.Spec.Data, true, nil
+	}
+	data, err := os.ReadFile(filepath.Join(secretsMountDir, sec.Spec.Name))
+	return data, true, err
+}
 
+// findNewTask returns the first task in serviceName's current task list that
+// wasn't present in the before snapshot
+func (sc *SwarmCronjob) findNewTask(serviceName string, before []*model.TaskInfo) (*model.TaskInfo, error) {
 	list, err := sc.docker.TaskList(serviceName)
 	if err != nil {
-		log.Error().Err(err)
-		return "", err
+		return nil, err
 	}
 
 	keys := make(map[string]*model.TaskInfo)
-	for _, x := range tasks {
+	for _, x := range before {
 		keys[x.ID] = x
 	}
 
-	// Получаем указатель на стартанувшую задачу
 	for _, x := range list {
-
 		if _, ok := keys[x.ID]; !ok {
-			log.Info().Msgf("Новая задача %s", x.ID)
-			log.Info().Msgf("Timiout - %s", wc.Job.EventTimeout)
-
-			timeout, _ := time.ParseDuration(wc.Job.EventTimeout)
-			for timeout := time.After(timeout); ; {
-				select {
-				case <-timeout:
-					log.Error().Msg("Timeout")
-					return "", errors.New("Timeout")
-				default:
-				}
+			return x, nil
+		}
+	}
 
-				tl, _ := sc.docker.TaskList(serviceName)
-				for _, tsk := range tl {
-					if tsk.ID == x.ID {
-						switch tsk.Status.State {
-						case swarm.TaskStateComplete:
-							logs, err := sc.docker.TaskLogs(context.Background(), tsk.ID)
-							if err != nil {
-								log.Error().Msgf("Cannot get logs for %s", tsk.ID)
-							}
-							return logs, nil
-						case swarm.TaskStateFailed:
-							return "", errors.New(tsk.Status.Err)
-						}
+	return nil, errors.New("Не найден список задач")
+}
+
+func (sc *SwarmCronjob) WaitForEnd(serviceName string, tasks []*model.TaskInfo) (string, error) {
+	wc, found := sc.mainJobEntry(serviceName)
+	if !found {
+		return "", errors.New("job not found")
+	}
+
+	x, err := sc.findNewTask(serviceName, tasks)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info().Msgf("Новая задача %s", x.ID)
+	log.Info().Msgf("Timiout - %s", wc.Job.EventTimeout)
+
+	timeout, _ := time.ParseDuration(wc.Job.EventTimeout)
+	for timeout := time.After(timeout); ; {
+		select {
+		case <-timeout:
+			log.Error().Msg("Timeout")
+			return "", errors.New("Timeout")
+		default:
+		}
+
+		tl, _ := sc.docker.TaskList(serviceName)
+		for _, tsk := range tl {
+			if tsk.ID == x.ID {
+				switch tsk.Status.State {
+				case swarm.TaskStateComplete:
+					logs, err := sc.docker.TaskLogs(context.Background(), tsk.ID)
+					if err != nil {
+						log.Error().Msgf("Cannot get logs for %s", tsk.ID)
 					}
+					return logs, nil
+				case swarm.TaskStateFailed:
+					return "", errors.New(tsk.Status.Err)
 				}
 			}
+		}
+	}
+}
+
+// StreamTask waits for the task started by the most recent event run to
+// appear, then streams its logs live until it finishes or ctx is cancelled
+func (sc *SwarmCronjob) StreamTask(ctx context.Context, serviceName string, tasks []*model.TaskInfo) (*model.TaskInfo, <-chan model.LogLine, error) {
+	var task *model.TaskInfo
+	for {
+		var err error
+		task, err = sc.findNewTask(serviceName, tasks)
+		if err == nil {
+			break
+		}
 
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
 		}
 	}
 
-	return "", errors.New("Не найден список задач")
+	lines, err := sc.docker.TaskLogsStream(ctx, task.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return task, lines, nil
+}
+
+// TaskStatus returns the current status of a task, used by streaming
+// consumers to report the final outcome once the log stream ends
+func (sc *SwarmCronjob) TaskStatus(serviceName string, taskID string) (*model.TaskInfo, error) {
+	list, err := sc.docker.TaskList(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	for _, tsk := range list {
+		if tsk.ID == taskID {
+			return tsk, nil
+		}
+	}
+	return nil, errors.New("task not found")
 }
@@ -1,17 +1,22 @@
 package docker
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"io"
 	"strings"
+	"sync"
 
 	"github.com/crazy-max/swarm-cronjob/internal/model"
 	"github.com/docker/cli/cli/command"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/pkg/errors"
 )
 
@@ -27,6 +32,18 @@ type Client interface {
 	Service(name string) (*model.ServiceInfo, error)
 	TaskList(service string) ([]*model.TaskInfo, error)
 	TaskLogs(ctx context.Context, taskid string) (string, error)
+	TaskLogsStream(ctx context.Context, taskID string) (<-chan model.LogLine, error)
+
+	ContainerExecCreate(ctx context.Context, containerID string, cmd []string) (string, error)
+	ContainerExecStart(ctx context.Context, execID string) (string, error)
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+
+	ConfigList(ctx context.Context, opts types.ConfigListOptions) ([]swarm.Config, error)
+	ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error)
+	ConfigCreate(ctx context.Context, spec swarm.ConfigSpec) (types.ConfigCreateResponse, error)
+	ConfigUpdate(ctx context.Context, id string, version swarm.Version, spec swarm.ConfigSpec) error
+
+	SecretInspectWithRaw(ctx context.Context, id string) (swarm.Secret, []byte, error)
 }
 
 type dockerClient struct {
@@ -94,6 +111,138 @@ func normalizeImage(image string) string {
 	return image
 }
 
+// ServiceList returns the services matching the given label filter
+func (c *dockerClient) ServiceList(args *model.ServiceListArgs) ([]*model.ServiceInfo, error) {
+	filter := filters.NewArgs()
+	for _, label := range args.Labels {
+		filter.Add("label", label)
+	}
+
+	services, err := c.api.ServiceList(context.Background(), types.ServiceListOptions{
+		Filters: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.ServiceInfo, 0, len(services))
+	for _, service := range services {
+		list = append(list, serviceInfo(service))
+	}
+	return list, nil
+}
+
+// Service returns a single service by name
+func (c *dockerClient) Service(name string) (*model.ServiceInfo, error) {
+	service, _, err := c.api.ServiceInspectWithRaw(context.Background(), name, types.ServiceInspectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return serviceInfo(service), nil
+}
+
+// TaskList returns the tasks currently associated with a service
+func (c *dockerClient) TaskList(service string) ([]*model.TaskInfo, error) {
+	filter := filters.NewArgs()
+	filter.Add("service", service)
+
+	tasks, err := c.api.TaskList(context.Background(), types.TaskListOptions{
+		Filters: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.TaskInfo, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, &model.TaskInfo{
+			ID:           task.ID,
+			ServiceID:    task.ServiceID,
+			DesiredState: task.DesiredState,
+			Status:       task.Status,
+		})
+	}
+	return list, nil
+}
+
+func serviceInfo(service swarm.Service) *model.ServiceInfo {
+	return &model.ServiceInfo{
+		ID:      service.ID,
+		Name:    service.Spec.Name,
+		Labels:  service.Spec.Labels,
+		Spec:    service.Spec,
+		Version: service.Version,
+	}
+}
+
+// ContainerExecCreate creates an exec instance for the given command inside
+// a running container and returns its ID
+func (c *dockerClient) ContainerExecCreate(ctx context.Context, containerID string, cmd []string) (string, error) {
+	resp, err := c.api.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// ContainerExecStart starts and attaches to an exec instance, returning its
+// combined stdout/stderr output once it completes
+func (c *dockerClient) ContainerExecStart(ctx context.Context, execID string) (string, error) {
+	hijacked, err := c.api.ContainerExecAttach(ctx, execID, types.ExecStartCheck{})
+	if err != nil {
+		return "", err
+	}
+	defer hijacked.Close()
+
+	// The exec is created without a TTY, so Docker multiplexes stdout and
+	// stderr onto the stream with an 8-byte frame header per chunk;
+	// stdcopy.StdCopy strips that framing before it reaches the caller.
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, hijacked.Reader); err != nil {
+		return "", err
+	}
+	return stdout.String() + stderr.String(), nil
+}
+
+// ContainerExecInspect returns the exit code and running state of an exec instance
+func (c *dockerClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	return c.api.ContainerExecInspect(ctx, execID)
+}
+
+// ConfigList returns the configs matching the given options
+func (c *dockerClient) ConfigList(ctx context.Context, opts types.ConfigListOptions) ([]swarm.Config, error) {
+	return c.api.ConfigList(ctx, opts)
+}
+
+// ConfigInspectWithRaw returns a single config and its raw data
+func (c *dockerClient) ConfigInspectWithRaw(ctx context.Context, id string) (swarm.Config, []byte, error) {
+	return c.api.ConfigInspectWithRaw(ctx, id)
+}
+
+// ConfigCreate creates a new config
+func (c *dockerClient) ConfigCreate(ctx context.Context, spec swarm.ConfigSpec) (types.ConfigCreateResponse, error) {
+	return c.api.ConfigCreate(ctx, spec)
+}
+
+// ConfigUpdate updates a config. The version number is required to avoid
+// conflicting writes, giving callers compare-and-swap semantics.
+func (c *dockerClient) ConfigUpdate(ctx context.Context, id string, version swarm.Version, spec swarm.ConfigSpec) error {
+	return c.api.ConfigUpdate(ctx, id, version, spec)
+}
+
+// SecretInspectWithRaw returns a secret's metadata and its raw spec data, if
+// the engine exposes it. The Swarm API only ever returns secret payloads to
+// the node a container mounting the secret runs on, so callers should treat
+// a successful response with empty data as "not available here" and fall
+// back to reading the mounted secret file instead.
+func (c *dockerClient) SecretInspectWithRaw(ctx context.Context, id string) (swarm.Secret, []byte, error) {
+	return c.api.SecretInspectWithRaw(ctx, id)
+}
+
 func (c *dockerClient) TaskLogs(ctx context.Context, taskid string) (string, error) {
 	r, err := c.api.TaskLogs(ctx, taskid, types.ContainerLogsOptions{
 		ShowStdout: true,
@@ -113,3 +262,54 @@ func (c *dockerClient) TaskLogs(ctx context.Context, taskid string) (string, err
 	return buf.String(), nil
 
 }
+
+// TaskLogsStream follows a task's logs and demultiplexes Docker's
+// stdout/stderr framing onto a channel of LogLine, one per line. The
+// channel is closed once the underlying stream ends or ctx is cancelled.
+func (c *dockerClient) TaskLogsStream(ctx context.Context, taskID string) (<-chan model.LogLine, error) {
+	r, err := c.api.TaskLogs(ctx, taskID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(chan model.LogLine)
+
+	go func() {
+		<-ctx.Done()
+		r.Close()
+	}()
+
+	go func() {
+		defer close(lines)
+		defer r.Close()
+
+		outR, outW := io.Pipe()
+		errR, errW := io.Pipe()
+
+		go func() {
+			_, _ = stdcopy.StdCopy(outW, errW, r)
+			outW.Close()
+			errW.Close()
+		}()
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go scanLines(&wg, outR, model.StreamStdout, lines)
+		go scanLines(&wg, errR, model.StreamStderr, lines)
+		wg.Wait()
+	}()
+
+	return lines, nil
+}
+
+func scanLines(wg *sync.WaitGroup, r io.Reader, stream string, lines chan<- model.LogLine) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines <- model.LogLine{Stream: stream, Line: scanner.Text()}
+	}
+}
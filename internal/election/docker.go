@@ -0,0 +1,139 @@
+package election
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/crazy-max/swarm-cronjob/internal/docker"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	leaderLabel   = "swarm-cronjob.leader"
+	renewedLabel  = "swarm-cronjob.renewed-at"
+	configDataTag = "swarm-cronjob-leader-election"
+)
+
+// dockerElector implements leader election on top of a Swarm config object,
+// using its Version.Index for compare-and-swap writes of the leader's
+// identity and last renewal time, stored as config labels since config
+// data itself is immutable once created
+type dockerElector struct {
+	docker docker.Client
+	cfg    Config
+
+	leading int32
+}
+
+// NewDocker creates an Elector backed by a well-known Swarm config
+func NewDocker(d docker.Client, cfg Config) Elector {
+	return &dockerElector{docker: d, cfg: cfg}
+}
+
+func (e *dockerElector) configName() string {
+	return e.cfg.Namespace + "-leader-election"
+}
+
+func (e *dockerElector) Run(ctx context.Context) {
+	e.tick()
+
+	ticker := time.NewTicker(renewInterval(e.cfg.LeaseDuration))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.tick()
+		}
+	}
+}
+
+func (e *dockerElector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+func (e *dockerElector) setLeading(leading bool) {
+	v := int32(0)
+	if leading {
+		v = 1
+	}
+	atomic.StoreInt32(&e.leading, v)
+}
+
+// tick attempts to acquire the lease if it's free or expired, or renew it
+// if this replica already holds it
+func (e *dockerElector) tick() {
+	filter := filters.NewArgs()
+	filter.Add("name", e.configName())
+
+	configs, err := e.docker.ConfigList(context.Background(), types.ConfigListOptions{Filters: filter})
+	if err != nil {
+		log.Error().Err(err).Msg("Leader election: cannot list config")
+		e.setLeading(false)
+		return
+	}
+
+	if len(configs) == 0 {
+		e.create()
+		return
+	}
+
+	e.acquireOrRenew(configs[0])
+}
+
+// create races other replicas to create the lease config. Only one create
+// call succeeds; the loser falls back to the acquire/renew path next tick.
+func (e *dockerElector) create() {
+	_, err := e.docker.ConfigCreate(context.Background(), swarm.ConfigSpec{
+		Annotations: swarm.Annotations{
+			Name: e.configName(),
+			Labels: map[string]string{
+				leaderLabel:  e.cfg.Identity,
+				renewedLabel: strconv.FormatInt(time.Now().Unix(), 10),
+			},
+		},
+		Data: []byte(configDataTag),
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("Leader election: lost the race to create the lease")
+		e.setLeading(false)
+		return
+	}
+	log.Info().Str("identity", e.cfg.Identity).Msg("Leader election: acquired leadership")
+	e.setLeading(true)
+}
+
+func (e *dockerElector) acquireOrRenew(config swarm.Config) {
+	leader := config.Spec.Labels[leaderLabel]
+	renewedAt, _ := strconv.ParseInt(config.Spec.Labels[renewedLabel], 10, 64)
+	expired := time.Since(time.Unix(renewedAt, 0)) > e.cfg.LeaseDuration
+
+	if leader != e.cfg.Identity && !expired {
+		e.setLeading(false)
+		return
+	}
+
+	spec := config.Spec
+	spec.Labels = map[string]string{
+		leaderLabel:  e.cfg.Identity,
+		renewedLabel: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+
+	if err := e.docker.ConfigUpdate(context.Background(), config.ID, config.Version, spec); err != nil {
+		log.Debug().Err(err).Msg("Leader election: lost the race to acquire or renew the lease")
+		e.setLeading(false)
+		return
+	}
+
+	if leader != e.cfg.Identity {
+		log.Info().Str("identity", e.cfg.Identity).Msg("Leader election: acquired leadership")
+	}
+	e.setLeading(true)
+}
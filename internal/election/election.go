@@ -0,0 +1,60 @@
+package election
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/crazy-max/swarm-cronjob/internal/docker"
+)
+
+// Backend names accepted by --leader-election-backend
+const (
+	BackendDocker = "docker"
+	BackendRedis  = "redis"
+)
+
+// Elector decides which replica of a highly-available swarm-cronjob
+// deployment is currently allowed to fire scheduled and event-driven runs
+type Elector interface {
+	// Run acquires and renews leadership until ctx is cancelled
+	Run(ctx context.Context)
+	// IsLeader reports whether this replica currently holds leadership
+	IsLeader() bool
+}
+
+// Config holds the options shared by every Elector backend
+type Config struct {
+	// Namespace scopes the lease so multiple swarm-cronjob deployments
+	// sharing a Docker swarm or Redis instance don't collide
+	Namespace string
+	// Identity uniquely identifies this replica, used as the lease holder
+	Identity string
+	// LeaseDuration is how long a lease is valid before it can be taken
+	// over by another replica
+	LeaseDuration time.Duration
+}
+
+// New creates the Elector for the given backend. redisAddr is only used
+// when backend is BackendRedis.
+func New(backend string, d docker.Client, redisAddr string, cfg Config) (Elector, error) {
+	switch backend {
+	case BackendDocker:
+		return NewDocker(d, cfg), nil
+	case BackendRedis:
+		return NewRedis(redisAddr, cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown leader election backend %q", backend)
+	}
+}
+
+// renewInterval is how often an Elector attempts to renew or acquire its
+// lease, a fraction of LeaseDuration so a renewal failure still leaves
+// margin before the lease actually expires
+func renewInterval(leaseDuration time.Duration) time.Duration {
+	interval := leaseDuration / 3
+	if interval < time.Second {
+		return time.Second
+	}
+	return interval
+}
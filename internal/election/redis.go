@@ -0,0 +1,93 @@
+package election
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// renewScript extends the lease's TTL only if this replica still owns it,
+// preventing a slow renewal from clobbering a lease someone else took over
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+else
+	return 0
+end
+`)
+
+// redisElector implements leader election with a SETNX-style lock in Redis
+type redisElector struct {
+	client *redis.Client
+	cfg    Config
+
+	leading int32
+}
+
+// NewRedis creates an Elector backed by a Redis lock
+func NewRedis(addr string, cfg Config) Elector {
+	return &redisElector{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		cfg:    cfg,
+	}
+}
+
+func (e *redisElector) key() string {
+	return e.cfg.Namespace + ":leader-election"
+}
+
+func (e *redisElector) Run(ctx context.Context) {
+	e.tick(ctx)
+
+	ticker := time.NewTicker(renewInterval(e.cfg.LeaseDuration))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.tick(ctx)
+		}
+	}
+}
+
+func (e *redisElector) IsLeader() bool {
+	return atomic.LoadInt32(&e.leading) == 1
+}
+
+func (e *redisElector) setLeading(leading bool) {
+	v := int32(0)
+	if leading {
+		v = 1
+	}
+	atomic.StoreInt32(&e.leading, v)
+}
+
+func (e *redisElector) tick(ctx context.Context) {
+	if e.IsLeader() {
+		renewed, err := renewScript.Run(ctx, e.client, []string{e.key()}, e.cfg.Identity, e.cfg.LeaseDuration.Milliseconds()).Int()
+		if err == nil && renewed == 1 {
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Leader election: cannot renew lease")
+		}
+		e.setLeading(false)
+	}
+
+	ok, err := e.client.SetNX(ctx, e.key(), e.cfg.Identity, e.cfg.LeaseDuration).Result()
+	if err != nil {
+		log.Error().Err(err).Msg("Leader election: cannot acquire lease")
+		e.setLeading(false)
+		return
+	}
+
+	if ok {
+		log.Info().Str("identity", e.cfg.Identity).Msg("Leader election: acquired leadership")
+	}
+	e.setLeading(ok)
+}
@@ -2,10 +2,18 @@ package eventservice
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/crazy-max/swarm-cronjob/internal/app"
+	"github.com/crazy-max/swarm-cronjob/internal/model"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/macaron.v1"
 )
@@ -15,46 +23,247 @@ type EventService struct {
 	srv     *http.Server
 	port    string
 	timeout string
+	tlsCert string
+	tlsKey  string
+	skew    time.Duration
+	nonces  *nonceCache
+	limiter *serviceLimiter
 }
 
-func NewEventService(app *app.SwarmCronjob, port string, timeout string) *EventService {
+func NewEventService(app *app.SwarmCronjob, cli *model.Cli) *EventService {
+	skew, err := time.ParseDuration(cli.EventSignatureSkew)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot parse event signature skew")
+	}
+
+	es := &EventService{
+		port:    cli.EventPort,
+		timeout: cli.EventTimeout,
+		tlsCert: cli.EventTLSCert,
+		tlsKey:  cli.EventTLSKey,
+		skew:    skew,
+		nonces:  newNonceCache(2 * skew),
+		limiter: newServiceLimiter(),
+	}
 
 	m := macaron.Classic()
 	m.Map(app)
+	m.Map(es)
 
 	m.Get("/event/:service/:key", handle)
+	m.Get("/metrics", macaron.Wrap(promhttp.HandlerFor(app.Metrics().Registry, promhttp.HandlerOpts{})))
+	m.Get("/healthz", healthz)
+	m.Get("/readyz", readyz)
 
-	es := &EventService{
-		m:       m,
-		port:    port,
-		timeout: timeout,
-	}
-
+	es.m = m
 	return es
 }
 
-func handle(app *app.SwarmCronjob, ctx *macaron.Context) (int, string) {
+// handle negotiates the response type for a triggered event from the
+// Accept header: text/event-stream streams SSE frames, application/x-ndjson
+// streams newline-delimited JSON, and anything else falls back to the
+// original single-blob text/plain behavior
+func handle(app *app.SwarmCronjob, es *EventService, ctx *macaron.Context) {
 	serviceName := ctx.Params(":service")
 	serviceKey := ctx.Params(":key")
-	log.Info().Str("service", serviceName)
+	log.Info().Str("service", serviceName).Msg("Event triggered")
+
+	if !es.limiter.Allow(serviceName) {
+		ctx.Resp.WriteHeader(http.StatusTooManyRequests)
+		_, _ = ctx.Resp.Write([]byte("rate limit exceeded"))
+		return
+	}
+
+	if err := es.verifySignedRequest(app, ctx, serviceName); err != nil {
+		log.Warn().Str("service", serviceName).Err(err).Msg("Rejected event request")
+		ctx.Resp.WriteHeader(http.StatusUnauthorized)
+		_, _ = ctx.Resp.Write([]byte(err.Error()))
+		return
+	}
 
 	tasks, err := app.Tasks(serviceName)
 	if err != nil {
-		return 500, err.Error()
+		ctx.Resp.WriteHeader(500)
+		_, _ = ctx.Resp.Write([]byte(err.Error()))
+		return
 	}
 	app.RunJobByEvent(serviceName, serviceKey)
 
+	switch accept := ctx.Req.Header.Get("Accept"); {
+	case strings.Contains(accept, "text/event-stream"):
+		handleSSE(app, ctx, serviceName, tasks)
+	case strings.Contains(accept, "application/x-ndjson"):
+		handleNDJSON(app, ctx, serviceName, tasks)
+	default:
+		handlePlain(app, ctx, serviceName, tasks)
+	}
+}
+
+// Headers carrying the HMAC signature, its timestamp and its nonce, as
+// described by the swarm.cronjob.event.secret label
+const (
+	headerTimestamp = "X-Swarm-Cronjob-Timestamp"
+	headerSignature = "X-Swarm-Cronjob-Signature"
+	headerNonce     = "X-Swarm-Cronjob-Nonce"
+)
+
+// verifySignedRequest enforces HMAC signature verification for services
+// that have a swarm.cronjob.event.secret label configured; services
+// without one keep relying on the plaintext key alone, so this is an
+// opt-in hardening on top of the existing key check in RunJobByEvent
+func (es *EventService) verifySignedRequest(app *app.SwarmCronjob, ctx *macaron.Context, serviceName string) error {
+	secret, configured, err := app.EventSecret(ctx.Req.Request.Context(), serviceName)
+	if !configured {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot resolve event secret: %w", err)
+	}
+
+	timestamp := ctx.Req.Header.Get(headerTimestamp)
+	signature := ctx.Req.Header.Get(headerSignature)
+	nonce := ctx.Req.Header.Get(headerNonce)
+	if timestamp == "" || signature == "" || nonce == "" {
+		return errors.New("missing signature headers")
+	}
+
+	if err := checkTimestamp(timestamp, es.skew); err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(ctx.Req.Request.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read request body: %w", err)
+	}
+
+	if !verifySignature(secret, timestamp, serviceName, nonce, body, signature) {
+		return errors.New("invalid signature")
+	}
+	if es.nonces.SeenOrRecord(nonce) {
+		return errors.New("nonce already used")
+	}
+	return nil
+}
+
+// handlePlain preserves the original behavior for clients that don't ask
+// for streaming: wait a bit for the task to start, then return its full
+// logs once it ends
+func handlePlain(app *app.SwarmCronjob, ctx *macaron.Context, serviceName string, tasks []*model.TaskInfo) {
 	time.Sleep(5 * time.Second)
 
 	msg, err := app.WaitForEnd(serviceName, tasks)
+	if err != nil {
+		ctx.Resp.WriteHeader(500)
+		_, _ = ctx.Resp.Write([]byte(err.Error()))
+		return
+	}
+	_, _ = ctx.Resp.Write([]byte(msg))
+}
 
+// streamContext opens the task log stream for a triggered event, bounded
+// by the job's configured event timeout and cancelled when the client
+// disconnects
+func streamContext(app *app.SwarmCronjob, ctx *macaron.Context, serviceName string, tasks []*model.TaskInfo) (*model.TaskInfo, <-chan model.LogLine, context.CancelFunc, error) {
+	timeout, err := app.EventTimeout(serviceName)
 	if err != nil {
-		return 500, err.Error()
-	} else {
-		return 200, msg
+		return nil, nil, nil, err
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx.Req.Request.Context(), timeout)
+	task, lines, err := app.StreamTask(streamCtx, serviceName, tasks)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	return task, lines, cancel, nil
+}
+
+// finalStatus returns a short status string once a task's log stream ends
+func finalStatus(app *app.SwarmCronjob, serviceName string, task *model.TaskInfo) string {
+	tsk, err := app.TaskStatus(serviceName, task.ID)
+	if err != nil {
+		return "unknown"
+	}
+	switch tsk.Status.State {
+	case swarm.TaskStateComplete:
+		return "complete"
+	case swarm.TaskStateFailed:
+		return "failed"
+	default:
+		return string(tsk.Status.State)
+	}
+}
+
+func handleSSE(app *app.SwarmCronjob, ctx *macaron.Context, serviceName string, tasks []*model.TaskInfo) {
+	task, lines, cancel, err := streamContext(app, ctx, serviceName, tasks)
+	if err != nil {
+		ctx.Resp.WriteHeader(500)
+		_, _ = ctx.Resp.Write([]byte(err.Error()))
+		return
+	}
+	defer cancel()
+
+	ctx.Resp.Header().Set("Content-Type", "text/event-stream")
+	ctx.Resp.Header().Set("Cache-Control", "no-cache")
+	ctx.Resp.Header().Set("Connection", "keep-alive")
+	ctx.Resp.WriteHeader(200)
+
+	flusher, canFlush := ctx.Resp.(http.Flusher)
+	for line := range lines {
+		fmt.Fprintf(ctx.Resp, "event: %s\ndata: %s\n\n", line.Stream, line.Line)
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+
+	fmt.Fprintf(ctx.Resp, "event: status\ndata: %s\n\n", finalStatus(app, serviceName, task))
+	if canFlush {
+		flusher.Flush()
 	}
 }
 
+func handleNDJSON(app *app.SwarmCronjob, ctx *macaron.Context, serviceName string, tasks []*model.TaskInfo) {
+	task, lines, cancel, err := streamContext(app, ctx, serviceName, tasks)
+	if err != nil {
+		ctx.Resp.WriteHeader(500)
+		_, _ = ctx.Resp.Write([]byte(err.Error()))
+		return
+	}
+	defer cancel()
+
+	ctx.Resp.Header().Set("Content-Type", "application/x-ndjson")
+	ctx.Resp.WriteHeader(200)
+
+	flusher, canFlush := ctx.Resp.(http.Flusher)
+	enc := json.NewEncoder(ctx.Resp)
+	for line := range lines {
+		_ = enc.Encode(line)
+		if canFlush {
+			flusher.Flush()
+		}
+	}
+
+	_ = enc.Encode(map[string]string{"status": finalStatus(app, serviceName, task)})
+	if canFlush {
+		flusher.Flush()
+	}
+}
+
+// healthz is a liveness probe: it reports that the process is up along
+// with this replica's current leadership state
+func healthz(app *app.SwarmCronjob, ctx *macaron.Context) (int, string) {
+	return 200, fmt.Sprintf("ok (leader=%t)", app.IsLeader())
+}
+
+// readyz is a readiness probe: it reports whether the Docker events loop
+// is currently connected
+func readyz(app *app.SwarmCronjob, ctx *macaron.Context) (int, string) {
+	if !app.Ready() {
+		return 503, "not ready"
+	}
+	return 200, "ok"
+}
+
 func (es *EventService) Run() {
 
 	timeout, err := time.ParseDuration(es.timeout)
@@ -69,11 +278,18 @@ func (es *EventService) Run() {
 		WriteTimeout: timeout,
 		ReadTimeout:  15 * time.Second,
 	}
+	es.srv = srv
 
 	log.Info().Msgf("Запуск на порту %s", es.port)
 
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if es.tlsCert != "" && es.tlsKey != "" {
+			err = srv.ListenAndServeTLS(es.tlsCert, es.tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal().Msgf("listen:%+s\n", err)
 		}
 	}()
@@ -0,0 +1,80 @@
+package eventservice
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// nonceMaxEntries bounds the memory used by the replay-protection cache;
+// once full, the least recently seen nonce is evicted to make room
+const nonceMaxEntries = 10000
+
+type nonceEntry struct {
+	nonce string
+	seen  time.Time
+}
+
+// nonceCache is an LRU of recently seen signature nonces, used to reject
+// replayed /event requests even within the accepted timestamp skew
+type nonceCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// SeenOrRecord atomically checks whether the nonce has already been
+// recorded within the cache's TTL and, if not, records it in the same
+// lock acquisition. Callers must verify the signature before calling this,
+// so that an unauthenticated guess never burns a nonce a legitimate
+// caller might need; checking and recording in one step then closes the
+// window a separate check-then-set pair would leave for two concurrent
+// replays of the same captured-valid request to both pass.
+func (c *nonceCache) SeenOrRecord(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.evictExpired(now)
+
+	if el, ok := c.entries[nonce]; ok {
+		c.order.MoveToFront(el)
+		return true
+	}
+
+	if c.order.Len() >= nonceMaxEntries {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*nonceEntry).nonce)
+		}
+	}
+
+	el := c.order.PushFront(&nonceEntry{nonce: nonce, seen: now})
+	c.entries[nonce] = el
+	return false
+}
+
+func (c *nonceCache) evictExpired(now time.Time) {
+	for {
+		oldest := c.order.Back()
+		if oldest == nil {
+			return
+		}
+		entry := oldest.Value.(*nonceEntry)
+		if now.Sub(entry.seen) <= c.ttl {
+			return
+		}
+		c.order.Remove(oldest)
+		delete(c.entries, entry.nonce)
+	}
+}
@@ -0,0 +1,83 @@
+package eventservice
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// signaturePrefix is prepended to the hex-encoded HMAC in the
+// X-Swarm-Cronjob-Signature header, naming the digest algorithm
+const signaturePrefix = "sha256="
+
+// eventRateLimit and eventRateBurst bound how often a single service's
+// event endpoint can be triggered, independent of whether the signature
+// checks out, to blunt brute-force and flooding attempts
+const (
+	eventRateLimit = rate.Limit(1)
+	eventRateBurst = 3
+)
+
+// verifySignature reports whether signature is a valid
+// sha256=hex(HMAC(secret, timestamp+"\n"+service+"\n"+nonce+"\n"+body))
+// over the given fields
+func verifySignature(secret []byte, timestamp, service, nonce string, body []byte, signature string) bool {
+	want, ok := strings.CutPrefix(signature, signaturePrefix)
+	if !ok {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(service))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	got := hex.EncodeToString(mac.Sum(nil))
+
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// checkTimestamp parses an RFC3339 timestamp and rejects it if it falls
+// outside of the accepted clock skew window
+func checkTimestamp(timestamp string, skew time.Duration) error {
+	ts, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if age := time.Since(ts); age > skew || age < -skew {
+		return fmt.Errorf("timestamp outside of accepted %s skew", skew)
+	}
+	return nil
+}
+
+// serviceLimiter hands out a rate.Limiter per service name, creating one
+// lazily on first use
+type serviceLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newServiceLimiter() *serviceLimiter {
+	return &serviceLimiter{limiters: make(map[string]*rate.Limiter)}
+}
+
+func (sl *serviceLimiter) Allow(serviceName string) bool {
+	sl.mu.Lock()
+	limiter, ok := sl.limiters[serviceName]
+	if !ok {
+		limiter = rate.NewLimiter(eventRateLimit, eventRateBurst)
+		sl.limiters[serviceName] = limiter
+	}
+	sl.mu.Unlock()
+	return limiter.Allow()
+}
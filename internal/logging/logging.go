@@ -0,0 +1,29 @@
+package logging
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crazy-max/swarm-cronjob/internal/model"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Configure sets up the global zerolog logger based on the CLI flags
+func Configure(cli *model.Cli) {
+	zerolog.TimeFieldFormat = time.RFC3339
+
+	level, err := zerolog.ParseLevel(strings.ToLower(cli.LogLevel))
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(level)
+
+	if cli.LogJSON {
+		log.Logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
+		return
+	}
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339})
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace is the prefix used for every metric exposed by swarm-cronjob
+const namespace = "swarm_cronjob"
+
+// Collector holds the Prometheus metrics tracked by swarm-cronjob and the
+// registry they are registered against
+type Collector struct {
+	Registry *prometheus.Registry
+
+	jobsRegistered prometheus.Gauge
+	runsTotal      *prometheus.CounterVec
+	runDuration    *prometheus.GaugeVec
+	tasksRunning   *prometheus.GaugeVec
+	nextScheduled  *prometheus.GaugeVec
+	leader         prometheus.Gauge
+}
+
+// New creates a Collector and registers its metrics on a fresh registry
+func New() *Collector {
+	c := &Collector{
+		Registry: prometheus.NewRegistry(),
+		jobsRegistered: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "jobs_registered",
+			Help:      "Number of cron jobs currently registered, exec jobs included",
+		}),
+		runsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Total number of job runs by service and result",
+		}, []string{"service", "result"}),
+		runDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "Duration in seconds of the last run of a service",
+		}, []string{"service"}),
+		tasksRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tasks_running",
+			Help:      "Number of tasks currently running, starting or pending for a service",
+		}, []string{"service"}),
+		nextScheduled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "next_scheduled_time_seconds",
+			Help:      "Unix timestamp of the next scheduled run for a service",
+		}, []string{"service"}),
+		leader: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "leader",
+			Help:      "1 if this replica currently holds leadership, 0 otherwise",
+		}),
+	}
+
+	c.Registry.MustRegister(
+		c.jobsRegistered,
+		c.runsTotal,
+		c.runDuration,
+		c.tasksRunning,
+		c.nextScheduled,
+		c.leader,
+	)
+
+	return c
+}
+
+// JobRegistered increments the number of registered jobs
+func (c *Collector) JobRegistered() {
+	c.jobsRegistered.Inc()
+}
+
+// JobRemoved decrements the number of registered jobs and clears its
+// tasks_running and next_scheduled_time_seconds series so stale jobs don't
+// linger in those gauges; runs_total and run_duration_seconds are kept
+func (c *Collector) JobRemoved(service string) {
+	c.jobsRegistered.Dec()
+	c.tasksRunning.DeleteLabelValues(service)
+	c.nextScheduled.DeleteLabelValues(service)
+}
+
+// ObserveRun records the outcome and duration of a finished run
+func (c *Collector) ObserveRun(service string, duration time.Duration, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	c.runsTotal.WithLabelValues(service, result).Inc()
+	c.runDuration.WithLabelValues(service).Set(duration.Seconds())
+}
+
+// SetTasksRunning sets the number of currently running tasks for a service
+func (c *Collector) SetTasksRunning(service string, n int) {
+	c.tasksRunning.WithLabelValues(service).Set(float64(n))
+}
+
+// SetNextScheduled records the next scheduled run time for a service
+func (c *Collector) SetNextScheduled(service string, next time.Time) {
+	c.nextScheduled.WithLabelValues(service).Set(float64(next.Unix()))
+}
+
+// SetLeader records whether this replica currently holds leadership
+func (c *Collector) SetLeader(leading bool) {
+	if leading {
+		c.leader.Set(1)
+		return
+	}
+	c.leader.Set(0)
+}
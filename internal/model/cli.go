@@ -4,9 +4,18 @@ import "github.com/alecthomas/kong"
 
 // Cli holds command line args, flags and cmds
 type Cli struct {
-	Version      kong.VersionFlag
-	LogLevel     string `kong:"name='log-level',env='LOG_LEVEL',default='info',help='Set log level.'"`
-	LogJSON      bool   `kong:"name='log-json',env='LOG_JSON',default='false',help='Enable JSON logging output.'"`
-	EventPort    string `kong:"name='event-port',env='EVENT_PORT',default='8080',help='Port for incoming event requests'"`
-	EventTimeout string `kong:"name='event-timeout',env='EVENT_TIMEOUT',default='1h',help='Max time for job'"`
+	Version            kong.VersionFlag
+	LogLevel           string `kong:"name='log-level',env='LOG_LEVEL',default='info',help='Set log level.'"`
+	LogJSON            bool   `kong:"name='log-json',env='LOG_JSON',default='false',help='Enable JSON logging output.'"`
+	EventPort          string `kong:"name='event-port',env='EVENT_PORT',default='8080',help='Port for incoming event requests'"`
+	EventTimeout       string `kong:"name='event-timeout',env='EVENT_TIMEOUT',default='1h',help='Max time for job'"`
+	EventSignatureSkew string `kong:"name='event-signature-skew',env='EVENT_SIGNATURE_SKEW',default='5m',help='Max age of a signed event request before it is rejected.'"`
+	EventTLSCert       string `kong:"name='event-tls-cert',env='EVENT_TLS_CERT',help='Path to a TLS certificate to serve the event endpoint over HTTPS.'"`
+	EventTLSKey        string `kong:"name='event-tls-key',env='EVENT_TLS_KEY',help='Path to the private key matching --event-tls-cert.'"`
+
+	LeaderElection              bool   `kong:"name='leader-election',env='LEADER_ELECTION',default='false',help='Enable leader election for HA deployments.'"`
+	LeaderElectionBackend       string `kong:"name='leader-election-backend',env='LEADER_ELECTION_BACKEND',default='docker',help='Leader election backend: docker or redis.'"`
+	LeaderElectionNamespace     string `kong:"name='leader-election-namespace',env='LEADER_ELECTION_NAMESPACE',default='swarm-cronjob',help='Namespace scoping the leader election lease.'"`
+	LeaderElectionLeaseDuration string `kong:"name='leader-election-lease-duration',env='LEADER_ELECTION_LEASE_DURATION',default='15s',help='Duration a leader election lease is valid for.'"`
+	LeaderElectionRedisAddr     string `kong:"name='leader-election-redis-addr',env='LEADER_ELECTION_REDIS_ADDR',default='127.0.0.1:6379',help='Redis address, used when backend is redis.'"`
 }
@@ -0,0 +1,11 @@
+package model
+
+// ServiceEvent holds the attributes of a Docker "service" event relevant to
+// swarm-cronjob
+type ServiceEvent struct {
+	Service     string `mapstructure:"name"`
+	UpdateState struct {
+		New string `mapstructure:"updatestate.new"`
+		Old string `mapstructure:"updatestate.old"`
+	} `mapstructure:",squash"`
+}
@@ -0,0 +1,43 @@
+package model
+
+// Job execution modes
+const (
+	// JobModeReplica scales the service up to run it; it is not scaled back
+	// down once the run has completed
+	JobModeReplica = ""
+	// JobModeExec execs a command inside a task of an already running service
+	JobModeExec = "exec"
+)
+
+// Concurrency policies, modelled on Kubernetes CronJob's .spec.concurrencyPolicy
+const (
+	// ConcurrencyAllow lets overlapping runs fire as today (default)
+	ConcurrencyAllow = "Allow"
+	// ConcurrencyForbid skips a scheduled run if the previous one is still running
+	ConcurrencyForbid = "Forbid"
+	// ConcurrencyReplace cancels the running task before starting the new one
+	ConcurrencyReplace = "Replace"
+)
+
+// Job holds the definition of a cron job derived from a service's
+// swarm.cronjob labels
+type Job struct {
+	Name                    string
+	Enable                  bool
+	Mode                    string
+	Schedule                string
+	SkipRunning             bool
+	Replicas                uint64
+	RegistryAuth            bool
+	EventRun                bool
+	EventRunKey             string
+	EventTimeout            string
+	EventSecretName         string
+	ConcurrencyPolicy       string
+	StartingDeadlineSeconds int64
+
+	// ExecName and ExecCommand are only set for JobModeExec jobs, sourced
+	// from swarm.cronjob.exec.<name>.schedule/command labels
+	ExecName    string
+	ExecCommand []string
+}
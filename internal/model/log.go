@@ -0,0 +1,14 @@
+package model
+
+// LogLine is a single line of task output tagged with the stream it came
+// from, used to demultiplex Docker's stdout/stderr framing
+type LogLine struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// Stream names for LogLine
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
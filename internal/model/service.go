@@ -0,0 +1,19 @@
+package model
+
+import "github.com/docker/docker/api/types/swarm"
+
+// ServiceListArgs holds arguments to filter the services returned by
+// docker.Client.ServiceList
+type ServiceListArgs struct {
+	Labels []string
+}
+
+// ServiceInfo holds the information needed to manage a Swarm service as a
+// cron job
+type ServiceInfo struct {
+	ID      string
+	Name    string
+	Labels  map[string]string
+	Spec    swarm.ServiceSpec
+	Version swarm.Version
+}
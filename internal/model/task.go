@@ -0,0 +1,12 @@
+package model
+
+import "github.com/docker/docker/api/types/swarm"
+
+// TaskInfo holds the information needed to track a Swarm task started for
+// a cron job
+type TaskInfo struct {
+	ID           string
+	ServiceID    string
+	DesiredState swarm.TaskState
+	Status       swarm.TaskStatus
+}
@@ -0,0 +1,253 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/crazy-max/swarm-cronjob/internal/docker"
+	"github.com/crazy-max/swarm-cronjob/internal/metrics"
+	"github.com/crazy-max/swarm-cronjob/internal/model"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// Client is a cron.Job that runs a Swarm service as a job. In replica mode
+// it scales the service up to Job.Replicas; it does not scale the service
+// back down once its tasks have completed. In exec mode it runs
+// Job.ExecCommand inside a running task of the service.
+type Client struct {
+	Docker  docker.Client
+	Metrics *metrics.Collector
+	Job     model.Job
+
+	// Cron and EntryID let Run look up the time it was scheduled to fire,
+	// used to enforce Job.StartingDeadlineSeconds, and the next fire time
+	// for the next_scheduled_time_seconds gauge. Set by app.crudJob right
+	// after registering the job.
+	Cron    *cron.Cron
+	EntryID cron.EntryID
+}
+
+// Run executes the job, satisfying the cron.Job interface
+func (c *Client) Run() {
+	defer c.recordNextScheduled()
+	if c.Job.Mode == model.JobModeExec {
+		c.runExec()
+		return
+	}
+	c.runReplica()
+}
+
+// runExec runs the job's command inside a task container of an already
+// running service, without touching its replica count
+func (c *Client) runExec() {
+	start := time.Now()
+	log.Info().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Msg("Starting exec job")
+
+	containerID, err := c.runningContainer()
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Err(err).Msg("Cannot find a running task")
+		c.recordResult(start, false)
+		return
+	}
+
+	execID, err := c.Docker.ContainerExecCreate(context.Background(), containerID, c.Job.ExecCommand)
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Err(err).Msg("Cannot create exec")
+		c.recordResult(start, false)
+		return
+	}
+
+	output, err := c.Docker.ContainerExecStart(context.Background(), execID)
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Err(err).Msg("Cannot start exec")
+		c.recordResult(start, false)
+		return
+	}
+
+	inspect, err := c.Docker.ContainerExecInspect(context.Background(), execID)
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Err(err).Msg("Cannot inspect exec")
+		c.recordResult(start, false)
+		return
+	}
+
+	log.Info().Str("service", c.Job.Name).Str("exec", c.Job.ExecName).Int("exitcode", inspect.ExitCode).Msg(output)
+	c.recordResult(start, inspect.ExitCode == 0)
+}
+
+// runningContainer returns the container ID of a currently running task of
+// the job's service
+func (c *Client) runningContainer() (string, error) {
+	tasks, err := c.Docker.TaskList(c.Job.Name)
+	if err != nil {
+		return "", err
+	}
+	for _, task := range tasks {
+		if task.Status.State == swarm.TaskStateRunning && task.Status.ContainerStatus != nil {
+			return task.Status.ContainerStatus.ContainerID, nil
+		}
+	}
+	return "", errors.New("no running task found")
+}
+
+func (c *Client) runReplica() {
+	start := time.Now()
+	log.Info().Str("service", c.Job.Name).Msg("Starting job")
+
+	if c.pastStartingDeadline(start) {
+		log.Error().Str("service", c.Job.Name).Msg("Starting deadline exceeded, dropping this run")
+		return
+	}
+
+	running, err := c.runningTasks()
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Err(err).Msg("Cannot list tasks")
+		c.recordResult(start, false)
+		return
+	}
+	c.recordTasksRunning(len(running))
+
+	if c.Job.SkipRunning && len(running) > 0 {
+		log.Info().Str("service", c.Job.Name).Msg("Skipping run, a task is already running")
+		return
+	}
+
+	switch c.Job.ConcurrencyPolicy {
+	case model.ConcurrencyForbid:
+		if len(running) > 0 {
+			log.Info().Str("service", c.Job.Name).Msg("Forbidding run, a task is already running")
+			return
+		}
+	case model.ConcurrencyReplace:
+		if len(running) > 0 {
+			log.Info().Str("service", c.Job.Name).Msg("Replacing in-flight task before starting a new one")
+			if err := c.scale(0); err != nil {
+				log.Error().Str("service", c.Job.Name).Err(err).Msg("Cannot scale down service to replace in-flight task")
+				c.recordResult(start, false)
+				return
+			}
+		}
+	}
+
+	service, err := c.Docker.Service(c.Job.Name)
+	if err != nil {
+		log.Error().Str("service", c.Job.Name).Err(err).Msg("Cannot inspect service")
+		c.recordResult(start, false)
+		return
+	}
+
+	spec := service.Spec
+	if spec.Mode.Replicated == nil {
+		log.Error().Str("service", c.Job.Name).Msg("Service mode is not replicated")
+		c.recordResult(start, false)
+		return
+	}
+
+	var encodedAuth string
+	if c.Job.RegistryAuth {
+		encodedAuth, err = c.Docker.RetrieveAuthTokenFromImage(context.Background(), spec.TaskTemplate.ContainerSpec.Image)
+		if err != nil {
+			log.Error().Str("service", c.Job.Name).Err(err).Msg("Cannot retrieve registry auth")
+		}
+	}
+
+	replicas := c.Job.Replicas
+	spec.Mode.Replicated.Replicas = &replicas
+	if _, err = c.Docker.ServiceUpdate(context.Background(), service.ID, service.Version, spec, types.ServiceUpdateOptions{
+		EncodedRegistryAuth: encodedAuth,
+	}); err != nil {
+		log.Error().Str("service", c.Job.Name).Err(err).Msg("Cannot scale up service")
+		c.recordResult(start, false)
+		return
+	}
+
+	c.recordResult(start, true)
+}
+
+// runningTasks returns the service's tasks that are running, starting or
+// pending, used to enforce SkipRunning and the concurrency policy
+func (c *Client) runningTasks() ([]*model.TaskInfo, error) {
+	tasks, err := c.Docker.TaskList(c.Job.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var running []*model.TaskInfo
+	for _, task := range tasks {
+		switch task.Status.State {
+		case swarm.TaskStateRunning, swarm.TaskStateStarting, swarm.TaskStatePending:
+			running = append(running, task)
+		}
+	}
+	return running, nil
+}
+
+// pastStartingDeadline reports whether this run fired too long after its
+// scheduled time to still be worth starting, e.g. because swarm-cronjob was
+// down when it should have fired
+func (c *Client) pastStartingDeadline(now time.Time) bool {
+	if c.Job.StartingDeadlineSeconds <= 0 || c.Cron == nil {
+		return false
+	}
+
+	scheduled := c.Cron.Entry(c.EntryID).Prev
+	if scheduled.IsZero() {
+		return false
+	}
+
+	deadline := time.Duration(c.Job.StartingDeadlineSeconds) * time.Second
+	return now.Sub(scheduled) > deadline
+}
+
+// scale force-updates the service to the given replica count, used by the
+// Replace concurrency policy to kill an in-flight task
+func (c *Client) scale(replicas uint64) error {
+	service, err := c.Docker.Service(c.Job.Name)
+	if err != nil {
+		return err
+	}
+	if service.Spec.Mode.Replicated == nil {
+		return errors.New("service mode is not replicated")
+	}
+
+	spec := service.Spec
+	spec.Mode.Replicated.Replicas = &replicas
+	_, err = c.Docker.ServiceUpdate(context.Background(), service.ID, service.Version, spec, types.ServiceUpdateOptions{})
+	return err
+}
+
+func (c *Client) recordResult(start time.Time, success bool) {
+	if c.Metrics == nil {
+		return
+	}
+	c.Metrics.ObserveRun(c.Job.Name, time.Since(start), success)
+}
+
+// recordTasksRunning updates the tasks_running gauge for this job's service
+func (c *Client) recordTasksRunning(n int) {
+	if c.Metrics == nil {
+		return
+	}
+	c.Metrics.SetTasksRunning(c.Job.Name, n)
+}
+
+// recordNextScheduled updates the next_scheduled_time_seconds gauge with
+// the entry's next fire time
+func (c *Client) recordNextScheduled() {
+	if c.Metrics == nil || c.Cron == nil {
+		return
+	}
+	next := c.Cron.Entry(c.EntryID).Next
+	if next.IsZero() {
+		return
+	}
+	key := c.Job.Name
+	if c.Job.Mode == model.JobModeExec {
+		key += "/" + c.Job.ExecName
+	}
+	c.Metrics.SetNextScheduled(key, next)
+}